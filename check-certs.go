@@ -5,23 +5,39 @@
 package main
 
 import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/sha256"
 	"crypto/tls"
 	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
 	"flag"
 	"fmt"
 	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
 	"strings"
 	"sync"
 	"time"
+
+	"golang.org/x/crypto/ocsp"
 )
 
 const defaultConcurrency = 8
 
 var (
-	columnNames        = "Hostname -- Common Name -- S/N -- Time to expire -- Expiration date"
+	columnNames        = "Hostname -- Common Name -- S/N -- Time to expire -- Expiration date -- OCSP Status -- Revocation Reason"
 	errExpiringShortly = "%s: ** '%s' (S/N %X) expires in %d hours ** at %s!"
 	errExpiringSoon    = "%s: '%s' (S/N %X) expires in roughly %d days on %s"
 	errSunsetAlg       = "%s: '%s' (S/N %X) expires after the sunset date for its signature algorithm '%s' on %s."
+	errOCSPRevoked     = "%s: ** '%s' (S/N %X) has been REVOKED via OCSP, reason %d, at %s **"
+	errOCSPStale       = "%s: '%s' (S/N %X) has a stale OCSP response, next update was %s"
+	errOCSPUnreachable = "%s: '%s' (S/N %X) could not be checked for revocation, no OCSP responder could be reached"
+	errFingerprint     = "%s: ** '%s' (S/N %X) does not match any expected fingerprint (got %s) **"
 )
 
 type sigAlgSunset struct {
@@ -59,32 +75,95 @@ var sunsetSigAlgs = map[x509.SignatureAlgorithm]sigAlgSunset{
 }
 
 var (
-	hostsFile    = flag.String("hosts", "", "The path to the file containing a list of hosts to check.")
-	warnYears    = flag.Int("years", 0, "Warn if the certificate will expire within this many years.")
-	warnMonths   = flag.Int("months", 0, "Warn if the certificate will expire within this many months.")
-	warnDays     = flag.Int("days", 0, "Warn if the certificate will expire within this many days.")
-	checkSigAlg  = flag.Bool("check-sig-alg", true, "Verify that non-root certificates are using a good signature algorithm.")
-	concurrency  = flag.Int("concurrency", defaultConcurrency, "Maximum number of hosts to check at once.")
-	outPutToFile = flag.Bool("output", false, "Output results to csv")        // create output file results.csv for results
-	serveFile    = flag.Bool("serve", false, "Serve output csv on port 8080") // create outputfile and serve results.csv on port 8080
+	hostsFile        = flag.String("hosts", "", "The path to the file containing a list of hosts to check.")
+	configFile       = flag.String("config", "", "The path to a YAML or TOML (by .toml extension) config file listing hosts, each of which may override warn_days, starttls, server_name, insecure_skip_verify, and fingerprints.")
+	scanDirFlag      = flag.String("scan-dir", "", "Instead of (or in addition to) dialing hosts, walk this directory and check every *.pem/*.crt file found.")
+	ctLogDomain      = flag.String("ct-log", "", "Monitor this domain via a Certificate Transparency log and probe discovered SANs as additional hosts.")
+	ctLogURL         = flag.String("ct-log-url", "https://ct.googleapis.com/logs/argon2024", "Base URL of the CT log to query with -ct-log.")
+	warnYears        = flag.Int("years", 0, "Warn if the certificate will expire within this many years.")
+	warnMonths       = flag.Int("months", 0, "Warn if the certificate will expire within this many months.")
+	warnDays         = flag.Int("days", 0, "Warn if the certificate will expire within this many days.")
+	checkSigAlg      = flag.Bool("check-sig-alg", true, "Verify that non-root certificates are using a good signature algorithm.")
+	checkRevoked     = flag.Bool("check-ocsp", true, "Verify that non-root certificates have not been revoked, via OCSP.")
+	ocspTimeout      = flag.Duration("ocsp-timeout", 10*time.Second, "Timeout for each OCSP request.")
+	dialTimeout      = flag.Duration("dial-timeout", 10*time.Second, "Timeout for establishing the TCP connection to a host.")
+	handshakeTimeout = flag.Duration("handshake-timeout", 10*time.Second, "Timeout for the TLS handshake with a host.")
+	totalTimeout     = flag.Duration("total-timeout", 30*time.Second, "Timeout for a single attempt at checking a host, dial and handshake included.")
+	maxRetries       = flag.Int("retries", 2, "Number of times to retry a host after a transient network error.")
+	rps              = flag.Float64("rps", 0, "Maximum host checks to start per second, shared across all workers. 0 means unlimited.")
+	starttls         = flag.String("starttls", "", "Protocol to use STARTTLS with (smtp, imap, pop3, ftp, ldap, postgres). Can be overridden per-host with a scheme prefix, e.g. smtp://host:25.")
+	concurrency      = flag.Int("concurrency", defaultConcurrency, "Maximum number of hosts to check at once.")
+	serveFile        = flag.Bool("serve", false, "Serve output csv on port 8080") // create outputfile and serve results.csv on port 8080
+	metricsAddr      = flag.String("metrics-addr", "", "Address to serve Prometheus metrics on (e.g. ':9117'). Also serves /results.csv for backwards compatibility.")
+	interval         = flag.Duration("interval", 0, "If set, re-run checks on this interval instead of exiting after one pass.")
+
+	outputFormat      = flag.String("output-format", "text", "Comma-separated list of output sinks to use: text, csv, json, ndjson, webhook.")
+	outputFile        = flag.String("output-file", "", "File path used by the csv, json, and ndjson sinks. If empty, each defaults to results.<format>, so multiple file sinks can run at once without clobbering each other.")
+	webhookURL        = flag.String("webhook-url", "", "URL to POST webhook payloads to. Required when webhook is among -output-format.")
+	webhookFormat     = flag.String("webhook-format", "generic", "Payload shape for the webhook sink: slack, pagerduty, or generic.")
+	webhookRoutingKey = flag.String("webhook-routing-key", "", "PagerDuty Events API v2 routing key. Required when -webhook-format=pagerduty.")
 )
 
+// hostSpec is a single host to probe, along with any per-host overrides of
+// the global defaults. It's built from -hosts file lines, -config entries,
+// and SANs discovered via -ct-log.
+type hostSpec struct {
+	hostport           string
+	proto              string
+	serverName         string
+	insecureSkipVerify bool
+	warnDays           int
+	fingerprints       []string
+}
+
 type certErrors struct {
-	commonName string
-	errs       []error
+	host                 string
+	commonName           string
+	errs                 []error
+	serialNumber         *big.Int
+	issuer               string
+	notBefore            time.Time
+	notAfter             time.Time
+	sigAlgSunset         bool
+	ocspRevoked          bool
+	ocspStatus           string
+	ocspRevocationReason string
+}
+
+// ocspRevocationReasons maps the RFC 5280 CRLReason codes returned in an
+// OCSP response to their human-readable names.
+var ocspRevocationReasons = map[int]string{
+	ocsp.Unspecified:          "unspecified",
+	ocsp.KeyCompromise:        "key compromise",
+	ocsp.CACompromise:         "ca compromise",
+	ocsp.AffiliationChanged:   "affiliation changed",
+	ocsp.Superseded:           "superseded",
+	ocsp.CessationOfOperation: "cessation of operation",
+	ocsp.CertificateHold:      "certificate hold",
+	ocsp.RemoveFromCRL:        "remove from crl",
+	ocsp.PrivilegeWithdrawn:   "privilege withdrawn",
+	ocsp.AACompromise:         "aa compromise",
 }
 
 type hostResult struct {
-	host  string
-	err   error
-	certs []certErrors
+	host              string
+	err               error
+	certs             []certErrors
+	handshakeDuration time.Duration
 }
 
+// globalRateLimiter throttles how often checkHost starts checking a host,
+// shared across every worker goroutine. Retries of a host that is already
+// being checked are not throttled. It's nil (and a no-op) until main
+// initializes it from -rps.
+var globalRateLimiter *rateLimiter
+
 func main() {
 
 	flag.Parse()
+	globalRateLimiter = newRateLimiter(*rps)
 
-	if len(*hostsFile) == 0 {
+	if len(*hostsFile) == 0 && len(*configFile) == 0 && len(*scanDirFlag) == 0 && len(*ctLogDomain) == 0 {
 		flag.Usage()
 		return
 	}
@@ -103,24 +182,35 @@ func main() {
 	if *concurrency < 0 {
 		*concurrency = defaultConcurrency
 	}
-	if *outPutToFile {
-		changeToCSV()
-		// create output file for results, the writing occurs in processHosts
-		createOutPutFile()
+	if (*serveFile || len(*metricsAddr) > 0) && !strings.Contains(*outputFormat, "csv") {
+		// The csv sink writes -output-file, which is what gets served.
+		*outputFormat += ",csv"
+	}
+	if len(*metricsAddr) > 0 {
+		go serveMetrics(*metricsAddr)
 	}
 	if *serveFile {
-		*outPutToFile = true // set this so that writing occurs in processHosts
-		changeToCSV()
-		createOutPutFile()
-		processHosts()
-		serveHTTP()
+		go serveHTTP()
 	}
 
 	//check hosts
+	if *interval > 0 {
+		for {
+			processHosts()
+			time.Sleep(*interval)
+		}
+	}
 	processHosts()
 }
 
 func processHosts() {
+	sinks, err := openSinks(*outputFormat)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	defer closeSinks(sinks)
+
 	done := make(chan struct{})
 	defer close(done)
 
@@ -140,41 +230,91 @@ func processHosts() {
 		close(results)
 	}()
 
+	allResults := make([]hostResult, 0)
 	for r := range results {
-		if r.err != nil {
-			fmt.Printf("%s: %v", r.host, r.err)
-			continue
+		allResults = append(allResults, r)
+		writeResult(r, sinks)
+	}
+
+	if len(*scanDirFlag) > 0 {
+		for _, r := range scanDir(*scanDirFlag) {
+			allResults = append(allResults, r)
+			writeResult(r, sinks)
 		}
-		fmt.Println(columnNames)
-		for _, cert := range r.certs {
-			for _, err := range cert.errs {
-				fmt.Println(err)
-				// write output file
-				if *outPutToFile {
-					outPutFile(err)
+	}
+
+	if len(*metricsAddr) > 0 {
+		recordMetrics(allResults)
+	}
+}
+
+// writeResult reports a single hostResult's problems to every active sink.
+func writeResult(r hostResult, sinks []ResultSink) {
+	if r.err != nil {
+		fmt.Printf("%s: %v\n", r.host, r.err)
+		sr := sinkResult{
+			host:     r.host,
+			severity: severityCritical,
+			message:  fmt.Sprintf("%s: %v", r.host, r.err),
+		}
+		for _, sink := range sinks {
+			if err := sink.Write(sr); err != nil {
+				fmt.Printf("%s: writing to sink: %v\n", r.host, err)
+			}
+		}
+		return
+	}
+
+	timeNow := time.Now()
+	for _, cert := range r.certs {
+		hoursToExpiry := int64(cert.notAfter.Sub(timeNow).Hours())
+		for _, certErr := range cert.errs {
+			sr := sinkResult{
+				host:             r.host,
+				commonName:       cert.commonName,
+				serialNumber:     cert.serialNumber.String(),
+				issuer:           cert.issuer,
+				notBefore:        cert.notBefore,
+				notAfter:         cert.notAfter,
+				hoursToExpiry:    hoursToExpiry,
+				severity:         classifySeverity(hoursToExpiry),
+				message:          certErr.Error(),
+				ocspStatus:       cert.ocspStatus,
+				revocationReason: cert.ocspRevocationReason,
+			}
+			for _, sink := range sinks {
+				if err := sink.Write(sr); err != nil {
+					fmt.Printf("%s: writing to sink: %v\n", r.host, err)
 				}
 			}
 		}
 	}
 }
 
-func queueHosts(done <-chan struct{}) <-chan string {
-	hosts := make(chan string)
+func queueHosts(done <-chan struct{}) <-chan hostSpec {
+	hosts := make(chan hostSpec)
 	go func() {
 		defer close(hosts)
 
-		fileContents, err := ioutil.ReadFile(*hostsFile)
-		if err != nil {
-			return
+		for _, spec := range loadHostsFile(*hostsFile) {
+			select {
+			case hosts <- spec:
+			case <-done:
+				return
+			}
 		}
-		lines := strings.Split(string(fileContents), "\n")
-		for _, line := range lines {
-			host := strings.TrimSpace(line)
-			if len(host) == 0 || host[0] == '#' {
-				continue
+
+		for _, spec := range loadConfigHosts(*configFile) {
+			select {
+			case hosts <- spec:
+			case <-done:
+				return
 			}
+		}
+
+		for _, spec := range loadCTHosts(*ctLogDomain, *ctLogURL) {
 			select {
-			case hosts <- host:
+			case hosts <- spec:
 			case <-done:
 				return
 			}
@@ -183,68 +323,368 @@ func queueHosts(done <-chan struct{}) <-chan string {
 	return hosts
 }
 
-func processQueue(done <-chan struct{}, hosts <-chan string, results chan<- hostResult) {
-	for host := range hosts {
+// loadHostsFile reads the -hosts file, one host per non-comment, non-blank
+// line. A line may include a STARTTLS protocol as a scheme prefix, e.g.
+// "smtp://mail.example.com:25"; otherwise it falls back to the -starttls
+// flag, if set.
+func loadHostsFile(path string) []hostSpec {
+	if len(path) == 0 {
+		return nil
+	}
+	fileContents, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+
+	var specs []hostSpec
+	lines := strings.Split(string(fileContents), "\n")
+	for _, line := range lines {
+		host := strings.TrimSpace(line)
+		if len(host) == 0 || host[0] == '#' {
+			continue
+		}
+		proto, hostport := splitHostProto(host)
+		specs = append(specs, hostSpec{hostport: hostport, proto: proto})
+	}
+	return specs
+}
+
+// splitHostProto splits a host file entry into its STARTTLS protocol, if
+// any, and the host:port to dial. A protocol may be given as a scheme
+// prefix on the entry itself, e.g. "smtp://mail.example.com:25"; otherwise
+// it falls back to the -starttls flag, if set.
+func splitHostProto(host string) (proto, hostport string) {
+	if idx := strings.Index(host, "://"); idx != -1 {
+		return host[:idx], host[idx+len("://"):]
+	}
+	return *starttls, host
+}
+
+func processQueue(done <-chan struct{}, hosts <-chan hostSpec, results chan<- hostResult) {
+	for spec := range hosts {
 		select {
-		case results <- checkHost(host):
+		case results <- checkHost(spec):
 		case <-done:
 			return
 		}
 	}
 }
 
-func checkHost(host string) (result hostResult) {
+// checkHost probes a single host, retrying transient network errors with
+// exponential backoff. Certificate-validation errors are never retried,
+// since dialing again won't change them. It always returns a hostResult,
+// even after exhausting retries, so sinks and metrics still see the host.
+func checkHost(spec hostSpec) (result hostResult) {
+	if err := globalRateLimiter.Wait(context.Background()); err != nil {
+		return hostResult{host: spec.hostport, err: err}
+	}
+
+	backoff := retryBaseDelay
+	for attempt := 0; ; attempt++ {
+		ctx, cancel := context.WithTimeout(context.Background(), *totalTimeout)
+		result = checkHostOnce(ctx, spec)
+		cancel()
+
+		if result.err == nil || attempt >= *maxRetries || !isTransientError(result.err) {
+			return result
+		}
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+// retryBaseDelay is the delay before the first retry; it doubles on each
+// subsequent attempt.
+const retryBaseDelay = 500 * time.Millisecond
+
+// isTransientError reports whether err looks like a network hiccup worth
+// retrying, as opposed to a certificate validation failure, which will
+// fail identically on every attempt.
+func isTransientError(err error) bool {
+	var certErr x509.CertificateInvalidError
+	var hostErr x509.HostnameError
+	var authErr x509.UnknownAuthorityError
+	if errors.As(err, &certErr) || errors.As(err, &hostErr) || errors.As(err, &authErr) {
+		return false
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return true
+	}
+	return errors.Is(err, context.DeadlineExceeded)
+}
+
+// checkHostOnce makes a single attempt to dial spec, negotiate TLS, and
+// evaluate the resulting certificate chain. ctx bounds the whole attempt;
+// -dial-timeout and -handshake-timeout further bound their respective
+// steps within it.
+func checkHostOnce(ctx context.Context, spec hostSpec) (result hostResult) {
 	result = hostResult{
-		host:  host,
+		host:  spec.hostport,
 		certs: []certErrors{},
 	}
-	conn, err := tls.Dial("tcp", host, nil)
+
+	handshakeStart := time.Now()
+
+	serverName, _, err := net.SplitHostPort(spec.hostport)
 	if err != nil {
-		result.err = err
-		return
+		serverName = spec.hostport
+	}
+	if len(spec.serverName) > 0 {
+		serverName = spec.serverName
+	}
+	tlsConfig := &tls.Config{ServerName: serverName, InsecureSkipVerify: spec.insecureSkipVerify}
+
+	dialer := &net.Dialer{Timeout: *dialTimeout}
+
+	var conn *tls.Conn
+	if len(spec.proto) == 0 {
+		dialCtx, cancel := context.WithTimeout(ctx, *dialTimeout)
+		rawConn, err := dialer.DialContext(dialCtx, "tcp", spec.hostport)
+		cancel()
+		if err != nil {
+			result.err = err
+			return
+		}
+
+		conn = tls.Client(rawConn, tlsConfig)
+		hsCtx, cancel := context.WithTimeout(ctx, *handshakeTimeout)
+		err = conn.HandshakeContext(hsCtx)
+		cancel()
+		if err != nil {
+			conn.Close()
+			result.err = err
+			return
+		}
+	} else {
+		startTLS, exists := startTLSFuncs[spec.proto]
+		if !exists {
+			result.err = fmt.Errorf("unknown STARTTLS protocol %q", spec.proto)
+			return
+		}
+
+		dialCtx, cancel := context.WithTimeout(ctx, *dialTimeout)
+		rawConn, err := dialer.DialContext(dialCtx, "tcp", spec.hostport)
+		cancel()
+		if err != nil {
+			result.err = err
+			return
+		}
+		if err := startTLS(rawConn); err != nil {
+			rawConn.Close()
+			result.err = fmt.Errorf("STARTTLS negotiation failed: %w", err)
+			return
+		}
+
+		conn = tls.Client(rawConn, tlsConfig)
+		hsCtx, cancel := context.WithTimeout(ctx, *handshakeTimeout)
+		err = conn.HandshakeContext(hsCtx)
+		cancel()
+		if err != nil {
+			conn.Close()
+			result.err = err
+			return
+		}
 	}
 	defer conn.Close()
+	result.handshakeDuration = time.Since(handshakeStart)
 
-	timeNow := time.Now()
+	warnCutoff := warnCutoffFor(spec.warnDays)
 	checkedCerts := make(map[string]struct{})
-	for _, chain := range conn.ConnectionState().VerifiedChains {
-		for certNum, cert := range chain {
-			if _, checked := checkedCerts[string(cert.Signature)]; checked {
-				continue
-			}
-			checkedCerts[string(cert.Signature)] = struct{}{}
-			cErrs := []error{}
-
-			// Check the expiration.
-			if timeNow.AddDate(*warnYears, *warnMonths, *warnDays).After(cert.NotAfter) {
-				expiresIn := int64(cert.NotAfter.Sub(timeNow).Hours())
-				if expiresIn <= 48 {
-					cErrs = append(cErrs, fmt.Errorf(errExpiringShortly, host, cert.Subject.CommonName, cert.SerialNumber, expiresIn, cert.NotAfter))
-				} else {
-					cErrs = append(cErrs, fmt.Errorf(errExpiringSoon, host, cert.Subject.CommonName, cert.SerialNumber, expiresIn/24, cert.NotAfter))
-				}
+	chains := conn.ConnectionState().VerifiedChains
+	if len(chains) == 0 {
+		// Only possible with InsecureSkipVerify, where no chain is built.
+		chains = [][]*x509.Certificate{conn.ConnectionState().PeerCertificates}
+	}
+	for _, chain := range chains {
+		result.certs = append(result.certs, evaluateChain(spec.hostport, chain, checkedCerts, conn.OCSPResponse(), warnCutoff, spec.fingerprints)...)
+	}
+
+	return
+}
+
+// warnCutoffFor returns the time after which a certificate should be
+// flagged as expiring soon. A positive warnDays overrides the global
+// -years/-months/-days flags for a single host.
+func warnCutoffFor(overrideDays int) time.Time {
+	if overrideDays > 0 {
+		return time.Now().AddDate(0, 0, overrideDays)
+	}
+	return time.Now().AddDate(*warnYears, *warnMonths, *warnDays)
+}
+
+// evaluateChain runs the expiration, signature-algorithm, OCSP, and
+// fingerprint checks over a verified certificate chain, skipping any
+// certificate already recorded in checkedCerts. It's shared by checkHost
+// (which has a live connection, and so a stapled OCSP response) and
+// scanDir (which doesn't).
+func evaluateChain(host string, chain []*x509.Certificate, checkedCerts map[string]struct{}, stapledOCSP []byte, warnCutoff time.Time, fingerprints []string) (entries []certErrors) {
+	timeNow := time.Now()
+	for certNum, cert := range chain {
+		if _, checked := checkedCerts[string(cert.Signature)]; checked {
+			continue
+		}
+		checkedCerts[string(cert.Signature)] = struct{}{}
+		cErrs := []error{}
+
+		// Check the expiration.
+		if warnCutoff.After(cert.NotAfter) {
+			expiresIn := int64(cert.NotAfter.Sub(timeNow).Hours())
+			if expiresIn <= 48 {
+				cErrs = append(cErrs, fmt.Errorf(errExpiringShortly, host, cert.Subject.CommonName, cert.SerialNumber, expiresIn, cert.NotAfter))
+			} else {
+				cErrs = append(cErrs, fmt.Errorf(errExpiringSoon, host, cert.Subject.CommonName, cert.SerialNumber, expiresIn/24, cert.NotAfter))
 			}
+		}
 
-			// Check the signature algorithm, ignoring the root certificate.
-			if alg, exists := sunsetSigAlgs[cert.SignatureAlgorithm]; *checkSigAlg && exists && certNum != len(chain)-1 {
-				if cert.NotAfter.Equal(alg.sunsetsAt) || cert.NotAfter.After(alg.sunsetsAt) {
-					cErrs = append(cErrs, fmt.Errorf(errSunsetAlg, host, cert.Subject.CommonName, cert.NotAfter, alg.name, cert.NotAfter))
-				}
+		// isRoot is true only for a genuine self-signed root CA certificate,
+		// not merely "last certificate we have" — a single-cert chain (e.g.
+		// a lone leaf from -scan-dir) has no root in it at all, and must
+		// still get the sig-alg and OCSP checks below.
+		isRoot := cert.IsCA && bytes.Equal(cert.RawIssuer, cert.RawSubject)
+		hasIssuer := certNum+1 < len(chain)
+
+		// Check the signature algorithm, ignoring the root certificate.
+		alg, pastSunset := sunsetSigAlgs[cert.SignatureAlgorithm]
+		pastSunset = pastSunset && !isRoot && (cert.NotAfter.Equal(alg.sunsetsAt) || cert.NotAfter.After(alg.sunsetsAt))
+		if *checkSigAlg && pastSunset {
+			cErrs = append(cErrs, fmt.Errorf(errSunsetAlg, host, cert.Subject.CommonName, cert.SerialNumber, alg.name, cert.NotAfter))
+		}
+
+		// Check for revocation via OCSP. This needs an issuer certificate to
+		// build the request, so it's skipped for a root or for a leaf we
+		// have no issuer for (e.g. a single-cert file from -scan-dir).
+		var revoked bool
+		var ocspStatus, ocspRevocationReason string
+		if *checkRevoked && !isRoot && hasIssuer {
+			var ocspErrs []error
+			revoked, ocspStatus, ocspRevocationReason, ocspErrs = checkOCSP(host, cert, chain[certNum+1], stapledOCSP)
+			cErrs = append(cErrs, ocspErrs...)
+		}
+
+		// Check against the expected fingerprints, if any were configured.
+		if len(fingerprints) > 0 {
+			sum := sha256.Sum256(cert.Raw)
+			fingerprint := hex.EncodeToString(sum[:])
+			if !containsFingerprint(fingerprints, fingerprint) {
+				cErrs = append(cErrs, fmt.Errorf(errFingerprint, host, cert.Subject.CommonName, cert.SerialNumber, fingerprint))
 			}
+		}
 
-			result.certs = append(result.certs, certErrors{
-				commonName: cert.Subject.CommonName,
-				errs:       cErrs,
-			})
+		issuer := cert.Subject.CommonName
+		if hasIssuer {
+			issuer = chain[certNum+1].Subject.CommonName
 		}
+		entries = append(entries, certErrors{
+			host:                 host,
+			commonName:           cert.Subject.CommonName,
+			errs:                 cErrs,
+			serialNumber:         cert.SerialNumber,
+			issuer:               issuer,
+			notBefore:            cert.NotBefore,
+			notAfter:             cert.NotAfter,
+			sigAlgSunset:         pastSunset,
+			ocspRevoked:          revoked,
+			ocspStatus:           ocspStatus,
+			ocspRevocationReason: ocspRevocationReason,
+		})
 	}
+	return
+}
+
+func containsFingerprint(fingerprints []string, fingerprint string) bool {
+	for _, f := range fingerprints {
+		if strings.EqualFold(f, fingerprint) {
+			return true
+		}
+	}
+	return false
+}
 
+// checkOCSP verifies that cert has not been revoked by its issuer, preferring
+// a stapled OCSP response from the TLS handshake and falling back to querying
+// each of cert.OCSPServer over the network.
+func checkOCSP(host string, cert, issuer *x509.Certificate, stapledOCSP []byte) (revoked bool, status, revocationReason string, cErrs []error) {
+	resp, err := ocsp.ParseResponse(stapledOCSP, issuer)
+	if err != nil {
+		resp, err = fetchOCSPResponse(cert, issuer)
+		if err != nil {
+			cErrs = append(cErrs, fmt.Errorf(errOCSPUnreachable, host, cert.Subject.CommonName, cert.SerialNumber))
+			return
+		}
+	}
+
+	switch resp.Status {
+	case ocsp.Good:
+		status = "good"
+	case ocsp.Revoked:
+		status = "revoked"
+	default:
+		status = "unknown"
+	}
+
+	if resp.Status == ocsp.Revoked {
+		revoked = true
+		revocationReason = ocspRevocationReasons[resp.RevocationReason]
+		cErrs = append(cErrs, fmt.Errorf(errOCSPRevoked, host, cert.Subject.CommonName, cert.SerialNumber, resp.RevocationReason, resp.RevokedAt))
+	}
+	if !resp.NextUpdate.IsZero() && resp.NextUpdate.Before(time.Now()) {
+		cErrs = append(cErrs, fmt.Errorf(errOCSPStale, host, cert.Subject.CommonName, cert.SerialNumber, resp.NextUpdate))
+	}
 	return
 }
 
-func changeToCSV() {
-	columnNames = "hostname, Common Name, S/N, time to expire, expiration date"
-	errExpiringShortly = "%s,  ** '%s', (S/N %X), %d hours **, %s"
-	errExpiringSoon = "%s, '%s', (S/N %X), %d days, %s"
-	errSunsetAlg = "%s, '%s', (S/N %X), expires after the sunset date for its signature algorithm '%s'., %s"
+// fetchOCSPResponse queries each of cert.OCSPServer in turn, returning the
+// first successfully parsed response. It tries POST first, since it's
+// preferred by RFC 6960, and falls back to GET if that fails.
+func fetchOCSPResponse(cert, issuer *x509.Certificate) (*ocsp.Response, error) {
+	req, err := ocsp.CreateRequest(cert, issuer, &ocsp.RequestOptions{Hash: crypto.SHA1})
+	if err != nil {
+		return nil, err
+	}
+
+	client := &http.Client{Timeout: *ocspTimeout}
+	var lastErr error
+	for _, server := range cert.OCSPServer {
+		raw, err := postOCSPRequest(client, server, req)
+		if err != nil {
+			raw, err = getOCSPRequest(client, server, req)
+		}
+		if err != nil {
+			lastErr = err
+			continue
+		}
+
+		resp, err := ocsp.ParseResponse(raw, issuer)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		return resp, nil
+	}
+	if lastErr == nil {
+		lastErr = fmt.Errorf("no OCSP responders configured")
+	}
+	return nil, lastErr
+}
+
+func postOCSPRequest(client *http.Client, server string, req []byte) ([]byte, error) {
+	httpResp, err := client.Post(server, "application/ocsp-request", bytes.NewReader(req))
+	if err != nil {
+		return nil, err
+	}
+	defer httpResp.Body.Close()
+	return ioutil.ReadAll(httpResp.Body)
+}
+
+func getOCSPRequest(client *http.Client, server string, req []byte) ([]byte, error) {
+	encoded := base64.StdEncoding.EncodeToString(req)
+	url := strings.TrimRight(server, "/") + "/" + encoded
+	httpResp, err := client.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer httpResp.Body.Close()
+	return ioutil.ReadAll(httpResp.Body)
 }
@@ -0,0 +1,69 @@
+// Copyright 2013 Ryan Rogers. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v2"
+)
+
+// hostConfigEntry is one host's worth of per-host overrides, as they appear
+// in a -config YAML or TOML file.
+type hostConfigEntry struct {
+	Host               string   `yaml:"host" toml:"host"`
+	WarnDays           int      `yaml:"warn_days" toml:"warn_days"`
+	StartTLS           string   `yaml:"starttls" toml:"starttls"`
+	ServerName         string   `yaml:"server_name" toml:"server_name"`
+	InsecureSkipVerify bool     `yaml:"insecure_skip_verify" toml:"insecure_skip_verify"`
+	Fingerprints       []string `yaml:"fingerprints" toml:"fingerprints"`
+}
+
+// hostConfigFile is the top-level shape of a -config YAML or TOML file.
+type hostConfigFile struct {
+	Hosts []hostConfigEntry `yaml:"hosts" toml:"hosts"`
+}
+
+// loadConfigHosts reads a -config file and returns the hostSpecs it
+// describes. The format is chosen by the file's extension: .toml is parsed
+// as TOML, everything else (including .yaml/.yml) as YAML. A missing or
+// unreadable path yields no hosts, matching loadHostsFile's behavior for a
+// missing -hosts file.
+func loadConfigHosts(path string) []hostSpec {
+	if len(path) == 0 {
+		return nil
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+
+	var cfg hostConfigFile
+	if strings.ToLower(filepath.Ext(path)) == ".toml" {
+		if _, err := toml.Decode(string(data), &cfg); err != nil {
+			return nil
+		}
+	} else {
+		if err := yaml.Unmarshal(data, &cfg); err != nil {
+			return nil
+		}
+	}
+
+	specs := make([]hostSpec, 0, len(cfg.Hosts))
+	for _, entry := range cfg.Hosts {
+		specs = append(specs, hostSpec{
+			hostport:           entry.Host,
+			proto:              entry.StartTLS,
+			serverName:         entry.ServerName,
+			insecureSkipVerify: entry.InsecureSkipVerify,
+			warnDays:           entry.WarnDays,
+			fingerprints:       entry.Fingerprints,
+		})
+	}
+	return specs
+}
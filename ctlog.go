@@ -0,0 +1,164 @@
+// Copyright 2013 Ryan Rogers. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// ctEntriesPageSize is how many leaves are requested per get-entries call.
+const ctEntriesPageSize = 256
+
+// ctMaxEntriesScanned bounds how much of the log -ct-log will walk looking
+// for certificates matching the monitored domain, so a busy log doesn't
+// turn a single scan into an unbounded crawl.
+const ctMaxEntriesScanned = 10000
+
+type ctSTH struct {
+	TreeSize int64 `json:"tree_size"`
+}
+
+type ctEntry struct {
+	LeafInput string `json:"leaf_input"`
+}
+
+type ctGetEntriesResponse struct {
+	Entries []ctEntry `json:"entries"`
+}
+
+// loadCTHosts queries logURL's get-entries API for certificates matching
+// domain, deduplicates the leaf certificates it finds by SHA256, and
+// returns the SANs of each as additional hosts to probe on port 443.
+//
+// Only x509_entry leaves are parsed; precertificate leaves are skipped,
+// since reconstructing their issuer-signed form requires data outside the
+// TBSCertificate this API returns.
+func loadCTHosts(domain, logURL string) []hostSpec {
+	if len(domain) == 0 {
+		return nil
+	}
+
+	sth, err := fetchSTH(logURL)
+	if err != nil {
+		fmt.Printf("ct-log: fetching signed tree head: %v\n", err)
+		return nil
+	}
+
+	seen := make(map[[sha256.Size]byte]struct{})
+	var specs []hostSpec
+	scanned := int64(0)
+	for start := int64(0); start < sth.TreeSize && scanned < ctMaxEntriesScanned; start += ctEntriesPageSize {
+		end := start + ctEntriesPageSize - 1
+		if end >= sth.TreeSize {
+			end = sth.TreeSize - 1
+		}
+
+		entries, err := fetchEntries(logURL, start, end)
+		if err != nil {
+			fmt.Printf("ct-log: fetching entries %d-%d: %v\n", start, end, err)
+			break
+		}
+		scanned += int64(len(entries))
+
+		for _, entry := range entries {
+			cert, err := parseCTLeafCert(entry.LeafInput)
+			if err != nil {
+				continue
+			}
+			if !certMatchesDomain(cert, domain) {
+				continue
+			}
+
+			sum := sha256.Sum256(cert.Raw)
+			if _, dup := seen[sum]; dup {
+				continue
+			}
+			seen[sum] = struct{}{}
+
+			for _, san := range cert.DNSNames {
+				specs = append(specs, hostSpec{hostport: san + ":443"})
+			}
+		}
+	}
+	if scanned >= ctMaxEntriesScanned && scanned < sth.TreeSize {
+		fmt.Printf("ct-log: stopped after scanning %d of %d entries\n", scanned, sth.TreeSize)
+	}
+	return specs
+}
+
+func fetchSTH(logURL string) (*ctSTH, error) {
+	resp, err := http.Get(strings.TrimRight(logURL, "/") + "/ct/v1/get-sth")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var sth ctSTH
+	if err := json.NewDecoder(resp.Body).Decode(&sth); err != nil {
+		return nil, err
+	}
+	return &sth, nil
+}
+
+func fetchEntries(logURL string, start, end int64) ([]ctEntry, error) {
+	url := fmt.Sprintf("%s/ct/v1/get-entries?start=%d&end=%d", strings.TrimRight(logURL, "/"), start, end)
+	resp, err := http.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var entries ctGetEntriesResponse
+	if err := json.NewDecoder(resp.Body).Decode(&entries); err != nil {
+		return nil, err
+	}
+	return entries.Entries, nil
+}
+
+// parseCTLeafCert extracts the leaf certificate from a base64-encoded
+// MerkleTreeLeaf, as described in RFC 6962 section 3.4. Only
+// x509_entry-typed leaves are supported.
+func parseCTLeafCert(leafInput string) (*x509.Certificate, error) {
+	raw, err := base64.StdEncoding.DecodeString(leafInput)
+	if err != nil {
+		return nil, err
+	}
+	if len(raw) < 15 {
+		return nil, fmt.Errorf("leaf input too short")
+	}
+	version, leafType := raw[0], raw[1]
+	if version != 0 || leafType != 0 {
+		return nil, fmt.Errorf("unsupported leaf version/type")
+	}
+
+	entryType := binary.BigEndian.Uint16(raw[10:12])
+	if entryType != 0 {
+		return nil, fmt.Errorf("precertificate leaf, not parsed")
+	}
+
+	certLen := int(raw[12])<<16 | int(raw[13])<<8 | int(raw[14])
+	if len(raw) < 15+certLen {
+		return nil, fmt.Errorf("leaf input truncated")
+	}
+	return x509.ParseCertificate(raw[15 : 15+certLen])
+}
+
+// certMatchesDomain reports whether cert covers domain, either directly or
+// as a subdomain.
+func certMatchesDomain(cert *x509.Certificate, domain string) bool {
+	for _, name := range cert.DNSNames {
+		if name == domain || strings.HasSuffix(name, "."+domain) {
+			return true
+		}
+	}
+	return false
+}
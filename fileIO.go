@@ -2,41 +2,94 @@ package main
 
 import (
 	"bufio"
+	"encoding/json"
 	"fmt"
 	"os"
 )
 
-func outPutFile(outPut error) error {
-	f, err := os.OpenFile("results.csv", os.O_APPEND|os.O_WRONLY, os.ModeAppend)
+// csvSink writes results as CSV to a file, one row per problem.
+type csvSink struct {
+	path string
+	file *os.File
+	w    *bufio.Writer
+}
+
+func (s *csvSink) Open() error {
+	f, err := os.Create(s.path)
 	if err != nil {
 		return err
 	}
-	defer f.Close()
+	s.file = f
+	s.w = bufio.NewWriter(f)
+	_, err = s.w.WriteString("hostname, common name, S/N, issuer, severity, hours to expire, expiration date, OCSP status, revocation reason, message\n")
+	return err
+}
+
+func (s *csvSink) Write(r sinkResult) error {
+	_, err := fmt.Fprintf(s.w, "%s, %s, %s, %s, %s, %d, %s, %s, %s, %q\n",
+		r.host, r.commonName, r.serialNumber, r.issuer, r.severity, r.hoursToExpiry, r.notAfter, r.ocspStatus, r.revocationReason, r.message)
+	return err
+}
+
+func (s *csvSink) Close() error {
+	if err := s.w.Flush(); err != nil {
+		s.file.Close()
+		return err
+	}
+	return s.file.Close()
+}
+
+// jsonSink collects every result and writes them as a single JSON array on
+// Close.
+type jsonSink struct {
+	path    string
+	file    *os.File
+	results []jsonResult
+}
 
-	_, err = f.WriteString(outPut.Error() + "\n")
+func (s *jsonSink) Open() error {
+	f, err := os.Create(s.path)
 	if err != nil {
 		return err
 	}
+	s.file = f
+	s.results = []jsonResult{}
 	return nil
+}
 
+func (s *jsonSink) Write(r sinkResult) error {
+	s.results = append(s.results, r.toJSON())
+	return nil
 }
 
-func createOutPutFile() {
-	// write output file
-	f, err := os.Create("results.csv")
-	check(err)
-	defer f.Close()
+func (s *jsonSink) Close() error {
+	defer s.file.Close()
+	enc := json.NewEncoder(s.file)
+	enc.SetIndent("", "  ")
+	return enc.Encode(s.results)
+}
 
-	w := bufio.NewWriter(f)
-	// String to put into file
-	_, err = fmt.Fprintf(w, "%s", columnNames+"\n")
-	check(err)
-	w.Flush()
-	f.Close()
+// ndjsonSink writes one JSON object per line, streamable as results arrive.
+type ndjsonSink struct {
+	path string
+	file *os.File
+	enc  *json.Encoder
 }
 
-func check(err error) {
+func (s *ndjsonSink) Open() error {
+	f, err := os.Create(s.path)
 	if err != nil {
-		panic(err)
+		return err
 	}
+	s.file = f
+	s.enc = json.NewEncoder(f)
+	return nil
+}
+
+func (s *ndjsonSink) Write(r sinkResult) error {
+	return s.enc.Encode(r.toJSON())
+}
+
+func (s *ndjsonSink) Close() error {
+	return s.file.Close()
 }
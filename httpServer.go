@@ -14,9 +14,10 @@ func serveHTTP() {
 func handler(response http.ResponseWriter, request *http.Request) {
 	//response.Header().Set("Content-type", "text/html")
 	response.Header().Set("Content-type", "text/csv")
-	webpage, err := ioutil.ReadFile("results.csv")
+	path := sinkPath("csv")
+	webpage, err := ioutil.ReadFile(path)
 	if err != nil {
-		http.Error(response, fmt.Sprintf("results.csv file error %v", err), 500)
+		http.Error(response, fmt.Sprintf("%s file error %v", path, err), 500)
 	}
 	fmt.Fprint(response, string(webpage))
 }
@@ -0,0 +1,128 @@
+// Copyright 2013 Ryan Rogers. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// handshakeBuckets are the upper bounds, in seconds, of the
+// certcheck_handshake_duration_seconds histogram.
+var handshakeBuckets = []float64{0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30}
+
+// metricsSnapshot is an immutable view of the most recent scan, ready to be
+// rendered in Prometheus text-exposition format. Scrapes always read a
+// complete snapshot, never a partially-updated one.
+type metricsSnapshot struct {
+	certs      []certErrors
+	handshakes map[string]time.Duration
+}
+
+var currentMetrics atomic.Value // holds *metricsSnapshot
+
+func init() {
+	currentMetrics.Store(&metricsSnapshot{})
+}
+
+// recordMetrics replaces the current metrics snapshot with the results of
+// the scan that just completed.
+func recordMetrics(results []hostResult) {
+	snapshot := &metricsSnapshot{
+		handshakes: make(map[string]time.Duration, len(results)),
+	}
+	for _, r := range results {
+		snapshot.handshakes[r.host] = r.handshakeDuration
+		for _, cert := range r.certs {
+			snapshot.certs = append(snapshot.certs, cert)
+		}
+	}
+	currentMetrics.Store(snapshot)
+}
+
+// serveMetrics starts an HTTP server exposing Prometheus metrics on /metrics,
+// and /results.csv for backwards compatibility with -serve.
+func serveMetrics(addr string) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", metricsHandler)
+	mux.HandleFunc("/results.csv", handler)
+	http.ListenAndServe(addr, mux)
+}
+
+func metricsHandler(response http.ResponseWriter, request *http.Request) {
+	snapshot := currentMetrics.Load().(*metricsSnapshot)
+
+	var buf strings.Builder
+	writeGauge(&buf, "certcheck_not_before_seconds", "Unix timestamp of the certificate's NotBefore field.")
+	for _, cert := range snapshot.certs {
+		fmt.Fprintf(&buf, "certcheck_not_before_seconds%s %d\n", certLabels(cert), cert.notBefore.Unix())
+	}
+
+	writeGauge(&buf, "certcheck_expiry_seconds", "Unix timestamp of the certificate's NotAfter field.")
+	for _, cert := range snapshot.certs {
+		fmt.Fprintf(&buf, "certcheck_expiry_seconds%s %d\n", certLabels(cert), cert.notAfter.Unix())
+	}
+
+	writeGauge(&buf, "certcheck_signature_algorithm_sunset", "1 if the certificate's signature algorithm is past its sunset date, 0 otherwise.")
+	for _, cert := range snapshot.certs {
+		fmt.Fprintf(&buf, "certcheck_signature_algorithm_sunset%s %d\n", certLabels(cert), boolToInt(cert.sigAlgSunset))
+	}
+
+	writeGauge(&buf, "certcheck_ocsp_revoked", "1 if the certificate has been revoked per OCSP, 0 otherwise.")
+	for _, cert := range snapshot.certs {
+		fmt.Fprintf(&buf, "certcheck_ocsp_revoked%s %d\n", certLabels(cert), boolToInt(cert.ocspRevoked))
+	}
+
+	writeHistogram(&buf, "certcheck_handshake_duration_seconds", "Time taken to establish and verify the TLS connection.")
+	hosts := make([]string, 0, len(snapshot.handshakes))
+	for host := range snapshot.handshakes {
+		hosts = append(hosts, host)
+	}
+	sort.Strings(hosts)
+	for _, host := range hosts {
+		writeHandshakeHistogram(&buf, host, snapshot.handshakes[host])
+	}
+
+	response.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	fmt.Fprint(response, buf.String())
+}
+
+func certLabels(cert certErrors) string {
+	return fmt.Sprintf(`{host=%q,cn=%q,serial=%q,issuer=%q}`, cert.host, cert.commonName, cert.serialNumber.String(), cert.issuer)
+}
+
+func writeGauge(buf *strings.Builder, name, help string) {
+	fmt.Fprintf(buf, "# HELP %s %s\n# TYPE %s gauge\n", name, help, name)
+}
+
+func writeHistogram(buf *strings.Builder, name, help string) {
+	fmt.Fprintf(buf, "# HELP %s %s\n# TYPE %s histogram\n", name, help, name)
+}
+
+func writeHandshakeHistogram(buf *strings.Builder, host string, d time.Duration) {
+	seconds := d.Seconds()
+	const count = 1
+	for _, bucket := range handshakeBuckets {
+		var inBucket uint64
+		if seconds <= bucket {
+			inBucket = count
+		}
+		fmt.Fprintf(buf, "certcheck_handshake_duration_seconds_bucket{host=%q,le=%q} %d\n", host, fmt.Sprintf("%g", bucket), inBucket)
+	}
+	fmt.Fprintf(buf, "certcheck_handshake_duration_seconds_bucket{host=%q,le=\"+Inf\"} %d\n", host, count)
+	fmt.Fprintf(buf, "certcheck_handshake_duration_seconds_sum{host=%q} %g\n", host, seconds)
+	fmt.Fprintf(buf, "certcheck_handshake_duration_seconds_count{host=%q} %d\n", host, count)
+}
+
+func boolToInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,52 @@
+// Copyright 2013 Ryan Rogers. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"time"
+)
+
+// rateLimiter is a single-token bucket, refilled at a fixed rate, shared by
+// every worker so a scan of thousands of hosts doesn't SYN-flood a shared
+// CDN. A nil *rateLimiter is a valid, unlimited no-op.
+type rateLimiter struct {
+	tokens chan struct{}
+}
+
+// newRateLimiter returns a rateLimiter that permits at most rps new checks
+// per second. It returns nil, meaning unlimited, if rps <= 0.
+func newRateLimiter(rps float64) *rateLimiter {
+	if rps <= 0 {
+		return nil
+	}
+
+	rl := &rateLimiter{tokens: make(chan struct{}, 1)}
+	interval := time.Duration(float64(time.Second) / rps)
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			select {
+			case rl.tokens <- struct{}{}:
+			default:
+			}
+		}
+	}()
+	return rl
+}
+
+// Wait blocks until a token is available or ctx is done.
+func (rl *rateLimiter) Wait(ctx context.Context) error {
+	if rl == nil {
+		return nil
+	}
+	select {
+	case <-rl.tokens:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,91 @@
+// Copyright 2013 Ryan Rogers. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// scanDir walks dir, running the same expiration, signature-algorithm, and
+// OCSP checks as checkHost against every certificate found in *.pem/*.crt
+// files. It reports one hostResult per file, using the file path in place
+// of a hostname.
+func scanDir(dir string) []hostResult {
+	var results []hostResult
+	filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			results = append(results, hostResult{host: path, err: err})
+			return nil
+		}
+		if info.IsDir() {
+			return nil
+		}
+		switch strings.ToLower(filepath.Ext(path)) {
+		case ".pem", ".crt":
+		default:
+			return nil
+		}
+
+		results = append(results, checkCertFile(path))
+		return nil
+	})
+	return results
+}
+
+// checkCertFile reads and evaluates every certificate chain found in a
+// single PEM or DER-encoded file.
+func checkCertFile(path string) hostResult {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return hostResult{host: path, err: err}
+	}
+
+	chain, err := parseCertChain(data)
+	if err != nil {
+		return hostResult{host: path, err: err}
+	}
+
+	result := hostResult{host: path, certs: []certErrors{}}
+	checkedCerts := make(map[string]struct{})
+	result.certs = evaluateChain(path, chain, checkedCerts, nil, warnCutoffFor(0), nil)
+	return result
+}
+
+// parseCertChain parses every certificate in data, trying PEM blocks first
+// and falling back to a single DER-encoded certificate (or chain of them).
+func parseCertChain(data []byte) ([]*x509.Certificate, error) {
+	var chain []*x509.Certificate
+	rest := data
+	for {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		chain = append(chain, cert)
+	}
+	if len(chain) > 0 {
+		return chain, nil
+	}
+
+	certs, err := x509.ParseCertificates(data)
+	if err != nil {
+		return nil, fmt.Errorf("no PEM certificates found and not a valid DER certificate: %v", err)
+	}
+	return certs, nil
+}
@@ -0,0 +1,165 @@
+// Copyright 2013 Ryan Rogers. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// severity is a coarse classification of how urgently a result needs
+// attention, derived from how soon the certificate expires.
+type severity string
+
+const (
+	severityInfo     severity = "INFO"
+	severityWarn     severity = "WARN"
+	severityCritical severity = "CRITICAL"
+)
+
+// classifySeverity turns hours-to-expiry into the severity every sink
+// reports: CRITICAL within 48 hours, WARN within a week, INFO otherwise. It
+// doesn't distinguish revocation or signature algorithm problems from
+// expiry problems, so a revoked certificate that expires more than a week
+// from now is reported as INFO; the result's message says which check
+// failed.
+func classifySeverity(hoursToExpiry int64) severity {
+	switch {
+	case hoursToExpiry <= 48:
+		return severityCritical
+	case hoursToExpiry <= 24*7:
+		return severityWarn
+	default:
+		return severityInfo
+	}
+}
+
+// sinkResult is one reported problem with a certificate, in the
+// sink-agnostic shape every ResultSink implementation consumes.
+type sinkResult struct {
+	host             string
+	commonName       string
+	serialNumber     string
+	issuer           string
+	notBefore        time.Time
+	notAfter         time.Time
+	hoursToExpiry    int64
+	severity         severity
+	message          string
+	ocspStatus       string
+	revocationReason string
+}
+
+// jsonResult is the exported, JSON-marshalable view of a sinkResult.
+type jsonResult struct {
+	Host             string    `json:"host"`
+	CommonName       string    `json:"common_name"`
+	SerialNumber     string    `json:"serial_number"`
+	Issuer           string    `json:"issuer"`
+	NotBefore        time.Time `json:"not_before"`
+	NotAfter         time.Time `json:"not_after"`
+	HoursToExpiry    int64     `json:"hours_to_expiry"`
+	Severity         string    `json:"severity"`
+	Message          string    `json:"message"`
+	OCSPStatus       string    `json:"ocsp_status,omitempty"`
+	RevocationReason string    `json:"revocation_reason,omitempty"`
+}
+
+func (r sinkResult) toJSON() jsonResult {
+	return jsonResult{
+		Host:             r.host,
+		CommonName:       r.commonName,
+		SerialNumber:     r.serialNumber,
+		Issuer:           r.issuer,
+		NotBefore:        r.notBefore,
+		NotAfter:         r.notAfter,
+		HoursToExpiry:    r.hoursToExpiry,
+		Severity:         string(r.severity),
+		Message:          r.message,
+		OCSPStatus:       r.ocspStatus,
+		RevocationReason: r.revocationReason,
+	}
+}
+
+// ResultSink receives the problems found during a scan. Open is called once
+// before the first Write, and Close once after the last, so file-based
+// sinks can hold a single handle open for the duration of the scan.
+type ResultSink interface {
+	Open() error
+	Write(sinkResult) error
+	Close() error
+}
+
+// textSink prints results to stdout, matching the tool's original output.
+type textSink struct{}
+
+func (textSink) Open() error {
+	fmt.Println(columnNames)
+	return nil
+}
+
+func (textSink) Write(r sinkResult) error {
+	fmt.Println(r.message)
+	return nil
+}
+
+func (textSink) Close() error { return nil }
+
+// openSinks builds and opens every sink named in a comma-separated
+// -output-format value.
+func openSinks(formats string) ([]ResultSink, error) {
+	var sinks []ResultSink
+	for _, name := range strings.Split(formats, ",") {
+		name = strings.TrimSpace(name)
+		if len(name) == 0 {
+			continue
+		}
+		sink, err := newSink(name)
+		if err != nil {
+			return nil, err
+		}
+		if err := sink.Open(); err != nil {
+			return nil, fmt.Errorf("opening %s sink: %v", name, err)
+		}
+		sinks = append(sinks, sink)
+	}
+	return sinks, nil
+}
+
+func newSink(name string) (ResultSink, error) {
+	switch name {
+	case "text":
+		return textSink{}, nil
+	case "csv":
+		return &csvSink{path: sinkPath("csv")}, nil
+	case "json":
+		return &jsonSink{path: sinkPath("json")}, nil
+	case "ndjson":
+		return &ndjsonSink{path: sinkPath("ndjson")}, nil
+	case "webhook":
+		return newWebhookSink(*webhookURL, *webhookFormat, *webhookRoutingKey)
+	default:
+		return nil, fmt.Errorf("unknown output format %q", name)
+	}
+}
+
+// sinkPath returns -output-file if the caller set one explicitly, otherwise
+// a format-specific default so the csv, json, and ndjson sinks don't all
+// fight over the same file when run together.
+func sinkPath(format string) string {
+	if len(*outputFile) > 0 {
+		return *outputFile
+	}
+	return "results." + format
+}
+
+func closeSinks(sinks []ResultSink) {
+	for _, sink := range sinks {
+		if err := sink.Close(); err != nil {
+			fmt.Printf("closing sink: %v\n", err)
+		}
+	}
+}
@@ -0,0 +1,198 @@
+// Copyright 2013 Ryan Rogers. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"net"
+)
+
+// ldapStartTLSOID is the OID of the StartTLS extended operation, as defined
+// in RFC 4511.
+const ldapStartTLSOID = "1.3.6.1.4.1.1466.20037"
+
+// startTLSFuncs maps a protocol scheme, as used in a host file entry or the
+// -starttls flag, to the function that performs that protocol's cleartext
+// negotiation of TLS.
+var startTLSFuncs = map[string]func(net.Conn) error{
+	"smtp":     startTLSSMTP,
+	"imap":     startTLSIMAP,
+	"pop3":     startTLSPOP3,
+	"ftp":      startTLSFTP,
+	"ldap":     startTLSLDAP,
+	"postgres": startTLSPostgres,
+}
+
+// startTLSSMTP performs the SMTP STARTTLS handshake described in RFC 3207:
+// read the greeting, send EHLO, then send STARTTLS and wait for a 220
+// response before handing the connection off for a TLS handshake.
+func startTLSSMTP(conn net.Conn) error {
+	r := bufio.NewReader(conn)
+	if _, err := readSMTPResponse(r); err != nil {
+		return fmt.Errorf("smtp: reading greeting: %v", err)
+	}
+	if _, err := fmt.Fprintf(conn, "EHLO go-check-certs\r\n"); err != nil {
+		return fmt.Errorf("smtp: sending EHLO: %v", err)
+	}
+	if _, err := readSMTPResponse(r); err != nil {
+		return fmt.Errorf("smtp: reading EHLO response: %v", err)
+	}
+	if _, err := fmt.Fprintf(conn, "STARTTLS\r\n"); err != nil {
+		return fmt.Errorf("smtp: sending STARTTLS: %v", err)
+	}
+	code, err := readSMTPResponse(r)
+	if err != nil {
+		return fmt.Errorf("smtp: reading STARTTLS response: %v", err)
+	}
+	if code != 220 {
+		return fmt.Errorf("smtp: STARTTLS refused, server said %d", code)
+	}
+	return nil
+}
+
+// readSMTPResponse reads a (possibly multi-line) SMTP response and returns
+// its status code.
+func readSMTPResponse(r *bufio.Reader) (code int, err error) {
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return 0, err
+		}
+		if len(line) < 4 {
+			return 0, fmt.Errorf("malformed response line %q", line)
+		}
+		if _, err := fmt.Sscanf(line[:3], "%d", &code); err != nil {
+			return 0, err
+		}
+		// A space after the code marks the final line of the response; a
+		// hyphen means more lines follow.
+		if line[3] == ' ' {
+			return code, nil
+		}
+	}
+}
+
+// startTLSIMAP performs the IMAP STARTTLS handshake described in RFC 3501:
+// read the greeting, send ". STARTTLS" and wait for the tagged "OK" response.
+func startTLSIMAP(conn net.Conn) error {
+	r := bufio.NewReader(conn)
+	if _, err := r.ReadString('\n'); err != nil {
+		return fmt.Errorf("imap: reading greeting: %v", err)
+	}
+	if _, err := fmt.Fprintf(conn, ". STARTTLS\r\n"); err != nil {
+		return fmt.Errorf("imap: sending STARTTLS: %v", err)
+	}
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return fmt.Errorf("imap: reading STARTTLS response: %v", err)
+		}
+		// Untagged "*" lines may come before the tagged response.
+		if !hasStatus(line, ". ") {
+			continue
+		}
+		if !hasStatus(line, ". OK") {
+			return fmt.Errorf("imap: STARTTLS refused: %s", line)
+		}
+		return nil
+	}
+}
+
+// startTLSPOP3 performs the POP3 STLS handshake described in RFC 2595: send
+// "STLS" and wait for a "+OK" response.
+func startTLSPOP3(conn net.Conn) error {
+	r := bufio.NewReader(conn)
+	if _, err := r.ReadString('\n'); err != nil {
+		return fmt.Errorf("pop3: reading greeting: %v", err)
+	}
+	if _, err := fmt.Fprintf(conn, "STLS\r\n"); err != nil {
+		return fmt.Errorf("pop3: sending STLS: %v", err)
+	}
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return fmt.Errorf("pop3: reading STLS response: %v", err)
+	}
+	if !hasStatus(line, "+OK") {
+		return fmt.Errorf("pop3: STLS refused: %s", line)
+	}
+	return nil
+}
+
+// startTLSFTP performs the FTP AUTH TLS handshake described in RFC 4217:
+// send "AUTH TLS" and wait for a 234 response.
+func startTLSFTP(conn net.Conn) error {
+	r := bufio.NewReader(conn)
+	if _, err := r.ReadString('\n'); err != nil {
+		return fmt.Errorf("ftp: reading greeting: %v", err)
+	}
+	if _, err := fmt.Fprintf(conn, "AUTH TLS\r\n"); err != nil {
+		return fmt.Errorf("ftp: sending AUTH TLS: %v", err)
+	}
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return fmt.Errorf("ftp: reading AUTH TLS response: %v", err)
+	}
+	if !hasStatus(line, "234") {
+		return fmt.Errorf("ftp: AUTH TLS refused: %s", line)
+	}
+	return nil
+}
+
+// startTLSLDAP performs the LDAP StartTLS handshake described in RFC 4511:
+// send an ExtendedRequest naming the StartTLS OID and read the reply. Only
+// the reply's leading LDAPMessage SEQUENCE tag is checked; its resultCode is
+// not examined, so a server that refuses StartTLS is not reported here and
+// the refusal surfaces as a failed TLS handshake instead.
+func startTLSLDAP(conn net.Conn) error {
+	if _, err := conn.Write(buildLDAPStartTLSRequest()); err != nil {
+		return fmt.Errorf("ldap: sending StartTLS request: %v", err)
+	}
+	buf := make([]byte, 256)
+	n, err := conn.Read(buf)
+	if err != nil {
+		return fmt.Errorf("ldap: reading StartTLS response: %v", err)
+	}
+	if n < 3 || buf[0] != 0x30 {
+		return fmt.Errorf("ldap: malformed StartTLS response")
+	}
+	return nil
+}
+
+// buildLDAPStartTLSRequest builds the BER-encoded LDAPMessage wrapping an
+// ExtendedRequest that names the StartTLS OID.
+func buildLDAPStartTLSRequest() []byte {
+	requestName := append([]byte{0x80, byte(len(ldapStartTLSOID))}, []byte(ldapStartTLSOID)...)
+	extendedRequest := append([]byte{0x77, byte(len(requestName))}, requestName...)
+	messageID := []byte{0x02, 0x01, 0x01}
+	body := append(messageID, extendedRequest...)
+	return append([]byte{0x30, byte(len(body))}, body...)
+}
+
+// startTLSPostgres performs the PostgreSQL SSL negotiation described in the
+// protocol docs: send an SSLRequest message and wait for a single 'S' byte
+// confirming the server supports TLS.
+func startTLSPostgres(conn net.Conn) error {
+	req := make([]byte, 8)
+	binary.BigEndian.PutUint32(req[0:4], 8)
+	binary.BigEndian.PutUint32(req[4:8], 80877103)
+	if _, err := conn.Write(req); err != nil {
+		return fmt.Errorf("postgres: sending SSLRequest: %v", err)
+	}
+	resp := make([]byte, 1)
+	if _, err := conn.Read(resp); err != nil {
+		return fmt.Errorf("postgres: reading SSLRequest response: %v", err)
+	}
+	if resp[0] != 'S' {
+		return fmt.Errorf("postgres: server does not support TLS")
+	}
+	return nil
+}
+
+// hasStatus reports whether line begins with the given status prefix.
+func hasStatus(line, prefix string) bool {
+	return len(line) >= len(prefix) && line[:len(prefix)] == prefix
+}
@@ -0,0 +1,127 @@
+// Copyright 2013 Ryan Rogers. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// webhookSink POSTs a JSON payload per problem cert to a webhook URL, in
+// one of a few shapes selectable via -webhook-format.
+type webhookSink struct {
+	url        string
+	format     string
+	routingKey string
+	client     *http.Client
+}
+
+func newWebhookSink(url, format, routingKey string) (*webhookSink, error) {
+	if len(url) == 0 {
+		return nil, fmt.Errorf("-webhook-url is required for the webhook sink")
+	}
+	switch format {
+	case "slack", "pagerduty", "generic":
+	default:
+		return nil, fmt.Errorf("unknown webhook format %q", format)
+	}
+	if format == "pagerduty" && len(routingKey) == 0 {
+		return nil, fmt.Errorf("-webhook-routing-key is required for -webhook-format=pagerduty")
+	}
+	return &webhookSink{
+		url:        url,
+		format:     format,
+		routingKey: routingKey,
+		client:     &http.Client{Timeout: 10 * time.Second},
+	}, nil
+}
+
+func (s *webhookSink) Open() error { return nil }
+
+func (s *webhookSink) Write(r sinkResult) error {
+	var payload interface{}
+	switch s.format {
+	case "slack":
+		payload = slackPayload(r)
+	case "pagerduty":
+		payload = s.pagerdutyPayload(r)
+	default:
+		payload = r.toJSON()
+	}
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	resp, err := s.client.Post(s.url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+func (s *webhookSink) Close() error { return nil }
+
+// slackMessage is a Slack incoming-webhook payload.
+type slackMessage struct {
+	Text string `json:"text"`
+}
+
+func slackPayload(r sinkResult) slackMessage {
+	return slackMessage{Text: fmt.Sprintf("[%s] %s", r.severity, r.message)}
+}
+
+// pagerdutyEvent is a PagerDuty Events API v2 trigger event.
+type pagerdutyEvent struct {
+	RoutingKey  string          `json:"routing_key"`
+	EventAction string          `json:"event_action"`
+	Payload     pagerdutyDetail `json:"payload"`
+}
+
+type pagerdutyDetail struct {
+	Summary       string                 `json:"summary"`
+	Source        string                 `json:"source"`
+	Severity      string                 `json:"severity"`
+	CustomDetails map[string]interface{} `json:"custom_details"`
+}
+
+func (s *webhookSink) pagerdutyPayload(r sinkResult) pagerdutyEvent {
+	return pagerdutyEvent{
+		RoutingKey:  s.routingKey,
+		EventAction: "trigger",
+		Payload: pagerdutyDetail{
+			Summary:  r.message,
+			Source:   r.host,
+			Severity: pagerdutySeverity(r.severity),
+			CustomDetails: map[string]interface{}{
+				"common_name":   r.commonName,
+				"serial_number": r.serialNumber,
+				"issuer":        r.issuer,
+				"not_after":     r.notAfter,
+			},
+		},
+	}
+}
+
+// pagerdutySeverity maps our severity to the values PagerDuty accepts:
+// critical, error, warning, or info.
+func pagerdutySeverity(s severity) string {
+	switch s {
+	case severityCritical:
+		return "critical"
+	case severityWarn:
+		return "warning"
+	default:
+		return "info"
+	}
+}